@@ -0,0 +1,39 @@
+package latlong
+
+import "math"
+
+const earthRadiusKm = 6371.0
+
+// LatLonger is implemented by any coordinate type that can report its
+// position as a latitude/longitude pair, in degrees.
+type LatLonger interface {
+	Lat() float64
+	Lon() float64
+}
+
+// Precise is implemented by coordinate types whose representation has a
+// bounded positional precision, in meters. Types that do not lose
+// precision (e.g. latlong.Coordinate itself) need not implement it.
+type Precise interface {
+	LatLonger
+	Precision() float64
+}
+
+// Distance returns the great-circle distance between a and b, in
+// kilometers, computed with the haversine formula.
+func Distance(a, b LatLonger) float64 {
+	lat1, lon1 := rad(a.Lat()), rad(a.Lon())
+	lat2, lon2 := rad(b.Lat()), rad(b.Lon())
+
+	dlat := lat2 - lat1
+	dlon := lon2 - lon1
+
+	h := haversine(dlat) + math.Cos(lat1)*math.Cos(lat2)*haversine(dlon)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// haversine is the haversine of an angle given in radians.
+func haversine(theta float64) float64 {
+	return (1 - math.Cos(theta)) / 2
+}
@@ -0,0 +1,12 @@
+package latlong
+
+// Place is a named location, as returned by a Geocoder.
+type Place struct {
+	City    string
+	Country string
+}
+
+// Geocoder resolves coordinates to the place name nearest them.
+type Geocoder interface {
+	ReverseGeocode(c Coordinate) (Place, error)
+}
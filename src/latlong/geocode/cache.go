@@ -0,0 +1,128 @@
+package geocode
+
+import (
+	"container/list"
+	"encoding/gob"
+	"latlong"
+	"os"
+	"sync"
+)
+
+// CachingGeocoder wraps another latlong.Geocoder with a disk-backed LRU
+// cache, so repeated coordinates are not re-queried.
+type CachingGeocoder struct {
+	underlying latlong.Geocoder
+	cachePath  string
+	capacity   int
+
+	mu      sync.Mutex
+	entries map[latlong.Coordinate]*list.Element
+	order   *list.List // front = most recently used
+}
+
+// cacheEntry is the value stored in order's list.Element.Value.
+type cacheEntry struct {
+	Coordinate latlong.Coordinate
+	Place      latlong.Place
+}
+
+// NewCaching wraps underlying in a CachingGeocoder of the given
+// capacity, loading any existing cache found at cachePath.
+func NewCaching(underlying latlong.Geocoder, cachePath string, capacity int) (*CachingGeocoder, error) {
+	g := &CachingGeocoder{
+		underlying: underlying,
+		cachePath:  cachePath,
+		capacity:   capacity,
+		entries:    make(map[latlong.Coordinate]*list.Element),
+		order:      list.New(),
+	}
+
+	if err := g.load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return g, nil
+}
+
+// ReverseGeocode returns the cached Place for c if present, otherwise
+// queries the underlying Geocoder, caches the result, and persists the
+// cache to disk.
+func (g *CachingGeocoder) ReverseGeocode(c latlong.Coordinate) (latlong.Place, error) {
+	g.mu.Lock()
+	if elem, ok := g.entries[c]; ok {
+		g.order.MoveToFront(elem)
+		place := elem.Value.(*cacheEntry).Place
+		g.mu.Unlock()
+		return place, nil
+	}
+	g.mu.Unlock()
+
+	place, err := g.underlying.ReverseGeocode(c)
+	if err != nil {
+		return latlong.Place{}, err
+	}
+
+	g.mu.Lock()
+	g.put(c, place)
+	err = g.save()
+	g.mu.Unlock()
+
+	return place, err
+}
+
+// put inserts c -> place, evicting the least recently used entry if
+// the cache is over capacity. Callers must hold g.mu.
+func (g *CachingGeocoder) put(c latlong.Coordinate, place latlong.Place) {
+	if elem, ok := g.entries[c]; ok {
+		elem.Value.(*cacheEntry).Place = place
+		g.order.MoveToFront(elem)
+		return
+	}
+
+	elem := g.order.PushFront(&cacheEntry{Coordinate: c, Place: place})
+	g.entries[c] = elem
+
+	for g.capacity > 0 && g.order.Len() > g.capacity {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.entries, oldest.Value.(*cacheEntry).Coordinate)
+	}
+}
+
+// load reads the cache file, if any, oldest entry first so that
+// re-inserting them (most-recently-used last) restores LRU order.
+func (g *CachingGeocoder) load() error {
+	f, err := os.Open(g.cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var saved []cacheEntry
+	if err := gob.NewDecoder(f).Decode(&saved); err != nil {
+		return err
+	}
+
+	for _, e := range saved {
+		g.put(e.Coordinate, e.Place)
+	}
+	return nil
+}
+
+// save persists the cache to disk, oldest entry first. Callers must
+// hold g.mu.
+func (g *CachingGeocoder) save() error {
+	saved := make([]cacheEntry, 0, g.order.Len())
+	for elem := g.order.Back(); elem != nil; elem = elem.Prev() {
+		saved = append(saved, *elem.Value.(*cacheEntry))
+	}
+
+	f, err := os.Create(g.cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewEncoder(f).Encode(saved)
+}
+
+var _ latlong.Geocoder = (*CachingGeocoder)(nil)
@@ -0,0 +1,60 @@
+package geocode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"latlong"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPGeocoder reverse-geocodes coordinates against a configurable
+// JSON HTTP endpoint, whose URL template contains {lat} and {lon}
+// placeholders, e.g. "https://example.com/reverse?lat={lat}&lon={lon}".
+// The endpoint is expected to respond with a JSON object shaped like
+// {"city": "...", "country": "..."}.
+type HTTPGeocoder struct {
+	URLTemplate string
+	Client      *http.Client
+}
+
+// NewHTTPGeocoder returns an HTTPGeocoder for the given URL template,
+// using http.DefaultClient.
+func NewHTTPGeocoder(urlTemplate string) *HTTPGeocoder {
+	return &HTTPGeocoder{URLTemplate: urlTemplate, Client: http.DefaultClient}
+}
+
+// httpResponse is the expected JSON shape of the geocoding endpoint.
+type httpResponse struct {
+	City    string `json:"city"`
+	Country string `json:"country"`
+}
+
+// ReverseGeocode queries the configured endpoint for c.
+func (g *HTTPGeocoder) ReverseGeocode(c latlong.Coordinate) (latlong.Place, error) {
+	url := strings.NewReplacer(
+		"{lat}", strconv.FormatFloat(c.Latitude, 'f', -1, 64),
+		"{lon}", strconv.FormatFloat(c.Longitude, 'f', -1, 64),
+	).Replace(g.URLTemplate)
+
+	resp, err := g.Client.Get(url)
+	if err != nil {
+		return latlong.Place{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return latlong.Place{}, errors.New(fmt.Sprintf("geocode: %s returned status %s", url, resp.Status))
+	}
+
+	var body httpResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return latlong.Place{}, err
+	}
+
+	return latlong.Place{City: body.City, Country: body.Country}, nil
+}
+
+var _ latlong.Geocoder = (*HTTPGeocoder)(nil)
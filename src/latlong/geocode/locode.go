@@ -0,0 +1,238 @@
+// Package geocode provides latlong.Geocoder implementations for
+// resolving a coordinate to the nearest named place.
+package geocode
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"latlong"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// entry is one UN/LOCODE record: a named place and its coordinates.
+type entry struct {
+	place latlong.Place
+	lat   float64
+	lon   float64
+}
+
+// kdNode is a node of a 2-D (lat, lon) k-d tree built over UN/LOCODE
+// entries.
+type kdNode struct {
+	entry       entry
+	left, right *kdNode
+}
+
+// LocodeGeocoder reverse-geocodes coordinates against a k-d tree of
+// UN/LOCODE entries, returning the nearest one.
+type LocodeGeocoder struct {
+	root *kdNode
+}
+
+// NewLocodeGeocoder builds a LocodeGeocoder from a UN/LOCODE CSV file.
+// Rows are expected to have "Country", "Name", and "Coordinates"
+// columns, with Coordinates in the standard UN/LOCODE format, e.g.
+// "5130N 00008W" for London.
+func NewLocodeGeocoder(csvPath string) (*LocodeGeocoder, error) {
+	f, err := os.Open(csvPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := readLocodeEntries(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(fmt.Sprintf("geocode: no entries read from %s", csvPath))
+	}
+
+	return &LocodeGeocoder{root: buildKDTree(entries, 0)}, nil
+}
+
+// readLocodeEntries parses a UN/LOCODE CSV, skipping rows whose
+// coordinates cannot be parsed.
+func readLocodeEntries(r io.Reader) ([]entry, error) {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := make(map[string]int, len(header))
+	for i, h := range header {
+		col[strings.TrimSpace(h)] = i
+	}
+
+	countryIdx, hasCountry := col["Country"]
+	nameIdx, hasName := col["Name"]
+	coordIdx, hasCoord := col["Coordinates"]
+	if !hasCountry || !hasName || !hasCoord {
+		return nil, errors.New("geocode: CSV is missing a Country, Name, or Coordinates column")
+	}
+
+	var out []entry
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lat, lon, err := parseLocodeCoordinates(record[coordIdx])
+		if err != nil {
+			continue
+		}
+
+		out = append(out, entry{
+			place: latlong.Place{City: record[nameIdx], Country: record[countryIdx]},
+			lat:   lat,
+			lon:   lon,
+		})
+	}
+	return out, nil
+}
+
+// parseLocodeCoordinates parses the UN/LOCODE "Coordinates" format,
+// e.g. "5130N 00008W" -> (51.5, -0.1333...).
+func parseLocodeCoordinates(s string) (lat, lon float64, err error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return 0, 0, errors.New(fmt.Sprintf("geocode: malformed coordinates: %q", s))
+	}
+
+	lat, err = parseDM(parts[0], 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	lon, err = parseDM(parts[1], 3)
+	if err != nil {
+		return 0, 0, err
+	}
+	return lat, lon, nil
+}
+
+// parseDM parses a degrees+minutes+hemisphere token, e.g. "5130N" or
+// "00008W", where degWidth is the number of leading digits that are
+// degrees (the rest, minus the trailing hemisphere letter, are
+// minutes).
+func parseDM(s string, degWidth int) (float64, error) {
+	if len(s) < degWidth+3 {
+		return 0, errors.New(fmt.Sprintf("geocode: malformed coordinate token: %q", s))
+	}
+
+	hemisphere := s[len(s)-1]
+	digits := s[:len(s)-1]
+
+	deg, err := strconv.Atoi(digits[:degWidth])
+	if err != nil {
+		return 0, err
+	}
+	min, err := strconv.Atoi(digits[degWidth:])
+	if err != nil {
+		return 0, err
+	}
+
+	value := float64(deg) + float64(min)/60
+
+	switch hemisphere {
+	case 'S', 'W':
+		value = -value
+	case 'N', 'E':
+		// no change
+	default:
+		return 0, errors.New(fmt.Sprintf("geocode: unknown hemisphere: %q", s))
+	}
+	return value, nil
+}
+
+// buildKDTree recursively builds a k-d tree over entries, alternating
+// the splitting axis between latitude (depth even) and longitude
+// (depth odd).
+func buildKDTree(entries []entry, depth int) *kdNode {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	axis := depth % 2
+	sortEntriesByAxis(entries, axis)
+
+	mid := len(entries) / 2
+	return &kdNode{
+		entry: entries[mid],
+		left:  buildKDTree(entries[:mid], depth+1),
+		right: buildKDTree(entries[mid+1:], depth+1),
+	}
+}
+
+func sortEntriesByAxis(entries []entry, axis int) {
+	less := func(i, j int) bool { return entries[i].lat < entries[j].lat }
+	if axis == 1 {
+		less = func(i, j int) bool { return entries[i].lon < entries[j].lon }
+	}
+	sort.Slice(entries, less)
+}
+
+// ReverseGeocode returns the UN/LOCODE entry nearest c.
+func (g *LocodeGeocoder) ReverseGeocode(c latlong.Coordinate) (latlong.Place, error) {
+	if g.root == nil {
+		return latlong.Place{}, errors.New("geocode: empty locode index")
+	}
+
+	best := g.root.entry
+	bestDist := sqDist(c.Latitude, c.Longitude, best.lat, best.lon)
+	search(g.root, c.Latitude, c.Longitude, 0, &best, &bestDist)
+	return best.place, nil
+}
+
+func search(n *kdNode, lat, lon float64, depth int, best *entry, bestDist *float64) {
+	if n == nil {
+		return
+	}
+
+	if d := sqDist(lat, lon, n.entry.lat, n.entry.lon); d < *bestDist {
+		*best = n.entry
+		*bestDist = d
+	}
+
+	axis := depth % 2
+	var diff float64
+	if axis == 0 {
+		diff = lat - n.entry.lat
+	} else {
+		diff = lon - n.entry.lon
+	}
+
+	nearNode, farNode := n.left, n.right
+	if diff > 0 {
+		nearNode, farNode = n.right, n.left
+	}
+
+	search(nearNode, lat, lon, depth+1, best, bestDist)
+	// Only the far subtree can possibly hold a closer point than the
+	// one already found: only bother searching it if the splitting
+	// plane itself is closer than our current best.
+	if diff*diff < *bestDist {
+		search(farNode, lat, lon, depth+1, best, bestDist)
+	}
+}
+
+// sqDist is the squared Euclidean distance in degree-space, which is
+// enough to compare candidates within a single k-d tree search.
+func sqDist(lat1, lon1, lat2, lon2 float64) float64 {
+	dlat := lat1 - lat2
+	dlon := lon1 - lon2
+	return dlat*dlat + dlon*dlon
+}
+
+var _ latlong.Geocoder = (*LocodeGeocoder)(nil)
@@ -0,0 +1,28 @@
+package spatial
+
+import (
+	"errors"
+	"fmt"
+	"latlong"
+)
+
+// Box is an axis-aligned latitude/longitude bounding box.
+type Box struct {
+	Min, Max latlong.Coordinate
+}
+
+// NewBox returns the Box spanning min to max. It is an error for min to
+// be greater than max on either axis.
+func NewBox(min, max latlong.Coordinate) (Box, error) {
+	if min.Latitude > max.Latitude || min.Longitude > max.Longitude {
+		return Box{}, errors.New(fmt.Sprintf("spatial: invalid box, min %+v is not <= max %+v", min, max))
+	}
+	return Box{Min: min, Max: max}, nil
+}
+
+// Contains reports whether p falls within the Box, inclusive of its
+// edges.
+func (b Box) Contains(p latlong.LatLonger) bool {
+	return p.Lat() >= b.Min.Latitude && p.Lat() <= b.Max.Latitude &&
+		p.Lon() >= b.Min.Longitude && p.Lon() <= b.Max.Longitude
+}
@@ -0,0 +1,74 @@
+// Package spatial builds a prefix-coded geohash index over
+// latlong.LatLonger points so callers can answer bounding-box and
+// radius queries without rescanning the raw trip data.
+//
+// Reference for geohashing can be found here:
+//   - https://en.wikipedia.org/wiki/Geohash
+package spatial
+
+import "latlong"
+
+// DefaultStep is the number of bits used per axis when no other
+// precision is requested, matching the 4x4 tile subdivision (2 bits
+// per axis per level) common to geo search libraries' prefix trees.
+const DefaultStep = 9
+
+// PrefixCoded is a geohash-style bit interleaving of a point's latitude
+// and longitude: bit 0 is the most significant longitude bit, bit 1 is
+// the most significant latitude bit, and so on, alternating. Points
+// that are near each other on earth share long byte prefixes.
+type PrefixCoded []byte
+
+// encode interleaves lat/lon into a PrefixCoded value with `step` bits
+// per axis (2*step bits total).
+func encode(lat, lon float64, step int) PrefixCoded {
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+
+	totalBits := step * 2
+	code := make(PrefixCoded, (totalBits+7)/8)
+
+	for bit := 0; bit < totalBits; bit++ {
+		var set bool
+		if bit%2 == 0 {
+			mid := (lonLo + lonHi) / 2
+			if lon >= mid {
+				set = true
+				lonLo = mid
+			} else {
+				lonHi = mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if lat >= mid {
+				set = true
+				latLo = mid
+			} else {
+				latHi = mid
+			}
+		}
+		if set {
+			code[bit/8] |= 1 << uint(7-bit%8)
+		}
+	}
+
+	return code
+}
+
+// Encode returns the PrefixCoded geohash of p at DefaultStep precision.
+func Encode(p latlong.LatLonger) PrefixCoded {
+	return encode(p.Lat(), p.Lon(), DefaultStep)
+}
+
+// commonPrefix returns the longest shared leading-byte run of a and b,
+// i.e. the prefix of the smallest byte-aligned geohash cell that
+// contains both. It
+// is used to narrow a bounding-box or radius query down to a
+// contiguous run of the sorted index before filtering exactly.
+func commonPrefix(a, b PrefixCoded) PrefixCoded {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
@@ -0,0 +1,199 @@
+package spatial
+
+import (
+	"latlong"
+	"math"
+	"sort"
+	"sync"
+)
+
+// point is one indexed trip point.
+type point struct {
+	code   PrefixCoded
+	tripID int
+	lat    float64
+	lon    float64
+}
+
+// bucketPrefixBytes is the length, in bytes, of the geohash prefix
+// Index shards its points by. At DefaultStep (9 bits/axis, 3-byte
+// codes) one byte of prefix divides the world into a 16x16 grid of
+// buckets, coarse enough to keep the bucket count small but fine
+// enough that a query only has to look at the handful of buckets its
+// search area overlaps.
+const bucketPrefixBytes = 1
+
+// Index is a prefix-coded geohash index over the points of many trips,
+// sharded into buckets keyed by a geohash prefix. Points are appended
+// to their bucket as they stream in; each bucket is one slice, so
+// points that all fall in the same bucket are held in a single slice.
+// Query and Near check only one bucket's points when a search area lies
+// within that bucket, and every bucket's points when it does not.
+type Index struct {
+	mu      sync.Mutex
+	buckets map[string][]point
+}
+
+// NewIndex returns an empty Index.
+func NewIndex() *Index {
+	return &Index{buckets: make(map[string][]point)}
+}
+
+// Insert adds a single trip point to the index.
+func (idx *Index) Insert(tripID int, p latlong.LatLonger) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	code := Encode(p)
+	key := string(code[:bucketPrefixBytes])
+	idx.buckets[key] = append(idx.buckets[key], point{
+		code:   code,
+		tripID: tripID,
+		lat:    p.Lat(),
+		lon:    p.Lon(),
+	})
+}
+
+// candidateBuckets returns the buckets that could hold a point whose
+// code starts with prefix. When prefix is at least bucketPrefixBytes
+// long it identifies a single bucket directly; otherwise every bucket
+// whose key starts with prefix is a candidate, found by scanning the
+// (always small, at most 256^bucketPrefixBytes) set of live bucket
+// keys. Callers must hold idx.mu.
+func (idx *Index) candidateBuckets(prefix PrefixCoded) [][]point {
+	if len(prefix) >= bucketPrefixBytes {
+		key := string(prefix[:bucketPrefixBytes])
+		if b, ok := idx.buckets[key]; ok {
+			return [][]point{b}
+		}
+		return nil
+	}
+
+	var out [][]point
+	for key, b := range idx.buckets {
+		if string(prefix) == key[:len(prefix)] {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Query returns the ids of every trip with at least one point inside
+// b, in ascending order with no duplicates. The geohash cell shared by
+// b's corners narrows the search to the buckets it could fall in
+// before points are checked against b exactly.
+func (idx *Index) Query(b Box) []int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	prefix := commonPrefix(
+		encode(b.Min.Latitude, b.Min.Longitude, DefaultStep),
+		encode(b.Max.Latitude, b.Max.Longitude, DefaultStep),
+	)
+
+	seen := make(map[int]bool)
+	var ids []int
+	for _, bucket := range idx.candidateBuckets(prefix) {
+		for _, p := range bucket {
+			if p.lat >= b.Min.Latitude && p.lat <= b.Max.Latitude &&
+				p.lon >= b.Min.Longitude && p.lon <= b.Max.Longitude {
+				if !seen[p.tripID] {
+					seen[p.tripID] = true
+					ids = append(ids, p.tripID)
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// kmPerDegreeLat is the approximate number of kilometers per degree of
+// latitude, used to bound a geohash cell search before the exact
+// haversine distance check in Near.
+const kmPerDegreeLat = 111.32
+
+// Near returns the ids of every trip with at least one point within
+// radiusKm kilometers of center, in ascending order with no duplicates.
+// The circle's bounding box narrows the search to the buckets it could
+// fall in before the exact distance check. Near the antimeridian that
+// bounding box can wrap from +180 back around to -180, so it is split
+// into one or two longitude ranges (by lonRanges) and searched
+// separately; clamping instead of wrapping would silently miss points
+// just across the 180 degree line from center.
+func (idx *Index) Near(center latlong.Coordinate, radiusKm float64) []int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	dLat := radiusKm / kmPerDegreeLat
+	minLat, maxLat := clampLat(center.Latitude-dLat), clampLat(center.Latitude+dLat)
+
+	// A circle that reaches a pole spans every longitude; otherwise its
+	// longitude half-width is asin(sin(r)/cos(lat)) for angular radius r.
+	dLon := 180.0
+	if minLat > -90 && maxLat < 90 {
+		r := dLat * math.Pi / 180
+		if s := math.Sin(r) / math.Cos(center.Latitude*math.Pi/180); s < 1 {
+			dLon = math.Asin(s) * 180 / math.Pi
+		}
+	}
+
+	seen := make(map[int]bool)
+	var ids []int
+	for _, lr := range lonRanges(center.Longitude-dLon, center.Longitude+dLon) {
+		prefix := commonPrefix(
+			encode(minLat, lr[0], DefaultStep),
+			encode(maxLat, lr[1], DefaultStep),
+		)
+		for _, bucket := range idx.candidateBuckets(prefix) {
+			for _, p := range bucket {
+				d := latlong.Distance(center, latlong.Coordinate{Latitude: p.lat, Longitude: p.lon})
+				if d <= radiusKm {
+					if !seen[p.tripID] {
+						seen[p.tripID] = true
+						ids = append(ids, p.tripID)
+					}
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// clampLat clamps a latitude to the valid [-90, 90] range, so a wide
+// search radius near the poles still yields a valid geohash cell.
+func clampLat(lat float64) float64 {
+	if lat < -90 {
+		return -90
+	}
+	if lat > 90 {
+		return 90
+	}
+	return lat
+}
+
+// lonRanges returns lo..hi as one or more [min, max] pairs, each within
+// the valid [-180, 180] longitude range. A lo..hi span that crosses
+// the antimeridian is split into two: the part up to +180, and the
+// part continuing from -180. A span wide enough to wrap all the way
+// around collapses to the whole [-180, 180] range.
+func lonRanges(lo, hi float64) [][2]float64 {
+	if hi-lo >= 360 {
+		return [][2]float64{{-180, 180}}
+	}
+
+	for lo < -180 {
+		lo += 360
+		hi += 360
+	}
+	for lo >= 180 {
+		lo -= 360
+		hi -= 360
+	}
+
+	if hi <= 180 {
+		return [][2]float64{{lo, hi}}
+	}
+	return [][2]float64{{lo, 180}, {-180, hi - 360}}
+}
@@ -0,0 +1,112 @@
+package spatial
+
+import (
+	"latlong"
+	"sort"
+	"testing"
+)
+
+type testPoint struct {
+	lat, lon float64
+}
+
+func (p testPoint) Lat() float64 { return p.lat }
+func (p testPoint) Lon() float64 { return p.lon }
+
+func TestQueryEquatorBox(t *testing.T) {
+	idx := NewIndex()
+	idx.Insert(1, testPoint{0.1, 10})  // inside
+	idx.Insert(2, testPoint{-0.1, 10}) // inside, just south of the equator
+	idx.Insert(3, testPoint{5, 10})    // outside
+
+	b, err := NewBox(
+		latlong.Coordinate{Latitude: -1, Longitude: 9},
+		latlong.Coordinate{Latitude: 1, Longitude: 11},
+	)
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+
+	got := idx.Query(b)
+	want := []int{1, 2}
+	if !sameInts(got, want) {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
+
+func TestQueryAntimeridianBox(t *testing.T) {
+	idx := NewIndex()
+	idx.Insert(1, testPoint{10, 179.5})  // inside, west of the line
+	idx.Insert(2, testPoint{10, -179.5}) // west of the box's min, excluded
+	idx.Insert(3, testPoint{10, 0})      // far away
+
+	b, err := NewBox(
+		latlong.Coordinate{Latitude: 9, Longitude: 179},
+		latlong.Coordinate{Latitude: 11, Longitude: 180},
+	)
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+
+	got := idx.Query(b)
+	want := []int{1}
+	if !sameInts(got, want) {
+		t.Errorf("Query() = %v, want %v", got, want)
+	}
+}
+
+func TestNearAntimeridian(t *testing.T) {
+	idx := NewIndex()
+	idx.Insert(1, testPoint{10, -179.95}) // ~16.4km from center, across the antimeridian
+	idx.Insert(2, testPoint{10, 0})       // far away
+
+	center := latlong.Coordinate{Latitude: 10, Longitude: 179.9}
+	got := idx.Near(center, 50)
+	want := []int{1}
+	if !sameInts(got, want) {
+		t.Errorf("Near() = %v, want %v", got, want)
+	}
+}
+
+func TestNearEquator(t *testing.T) {
+	idx := NewIndex()
+	idx.Insert(1, testPoint{0.01, 20})
+	idx.Insert(2, testPoint{-0.01, 20})
+	idx.Insert(3, testPoint{10, 20})
+
+	center := latlong.Coordinate{Latitude: 0, Longitude: 20}
+	got := idx.Near(center, 5)
+	want := []int{1, 2}
+	if !sameInts(got, want) {
+		t.Errorf("Near() = %v, want %v", got, want)
+	}
+}
+
+func TestNearPole(t *testing.T) {
+	idx := NewIndex()
+	idx.Insert(1, testPoint{89.95, 0})
+	idx.Insert(2, testPoint{89.95, 180})
+	idx.Insert(3, testPoint{89.95, -90})
+
+	center := latlong.Coordinate{Latitude: 90, Longitude: 0}
+	got := idx.Near(center, 10)
+	want := []int{1, 2, 3}
+	if !sameInts(got, want) {
+		t.Errorf("Near() = %v, want %v", got, want)
+	}
+}
+
+func sameInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]int(nil), a...), append([]int(nil), b...)
+	sort.Ints(a)
+	sort.Ints(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
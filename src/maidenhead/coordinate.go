@@ -0,0 +1,236 @@
+// Package maidenhead is a bidirectional Maidenhead grid locator
+// converter for go
+//
+// Reference for the Maidenhead Locator System can be found here:
+//   - https://en.wikipedia.org/wiki/Maidenhead_Locator_System
+package maidenhead
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"latlong"
+	"math"
+)
+
+// cosDeg is the cosine of an angle given in degrees.
+func cosDeg(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+
+// DefaultPrecision is the grid-square string length used by ToCoordinate
+// when no other precision has been requested.
+const DefaultPrecision = 6
+
+// pair describes one two-character group of a grid locator: how many
+// cells each axis is divided into at that level, and whether the
+// characters are letters (upper or lower case) or digits.
+type pair struct {
+	divisions int
+	letters   bool
+	upper     bool
+}
+
+// pairs describes the five supported locator levels, in order: field,
+// square, subsquare, extended square, and extended subsquare. Locators
+// longer than five pairs (10 characters) are not supported.
+var pairs = []pair{
+	{divisions: 18, letters: true, upper: true},  // field: A-R
+	{divisions: 10, letters: false},              // square: 0-9
+	{divisions: 24, letters: true, upper: false}, // subsquare: a-x
+	{divisions: 10, letters: false},              // extended square: 0-9
+	{divisions: 24, letters: true, upper: false}, // extended subsquare: a-x
+}
+
+// Coordinate represents a position on earth as a Maidenhead grid
+// locator string, e.g. "CM97cq53".
+type Coordinate struct {
+	Grid string
+}
+
+// ToCoordinate converts a latlong.LatLonger to its corresponding
+// Coordinate, encoded at DefaultPrecision characters.
+func ToCoordinate(l latlong.LatLonger) Coordinate {
+	return ToCoordinatePrecision(l, DefaultPrecision)
+}
+
+// ToCoordinatePrecision converts a latlong.LatLonger to its
+// corresponding Coordinate, encoded with the given number of grid
+// characters (4, 6, 8, or 10).
+func ToCoordinatePrecision(l latlong.LatLonger, precision int) Coordinate {
+	return Coordinate{Grid: encode(l.Lat(), l.Lon(), precision)}
+}
+
+// encode renders lat/lon (in degrees) as a grid locator string with the
+// given number of characters.
+func encode(lat, lon float64, precision int) string {
+	nPairs := precision / 2
+
+	lonRange, latRange := 360.0, 180.0
+	lonVal, latVal := lon+180, lat+90
+
+	grid := make([]byte, 0, precision)
+	for i := 0; i < nPairs && i < len(pairs); i++ {
+		p := pairs[i]
+
+		lonRange /= float64(p.divisions)
+		latRange /= float64(p.divisions)
+
+		lonIdx := int(lonVal / lonRange)
+		latIdx := int(latVal / latRange)
+
+		lonVal -= float64(lonIdx) * lonRange
+		latVal -= float64(latIdx) * latRange
+
+		grid = append(grid, p.encodeChar(lonIdx), p.encodeChar(latIdx))
+	}
+
+	return string(grid)
+}
+
+// encodeChar renders a single axis index as the character appropriate
+// for this pair's level.
+func (p pair) encodeChar(idx int) byte {
+	if !p.letters {
+		return byte('0' + idx)
+	}
+	if p.upper {
+		return byte('A' + idx)
+	}
+	return byte('a' + idx)
+}
+
+// decode parses a grid locator string and returns the lat/lon, in
+// degrees, of its centroid.
+func decode(grid string) (lat, lon float64, err error) {
+	if len(grid)%2 != 0 || len(grid) == 0 {
+		return 0, 0, errors.New(fmt.Sprintf("Invalid Maidenhead grid locator: %q", grid))
+	}
+
+	nPairs := len(grid) / 2
+	if nPairs > len(pairs) {
+		return 0, 0, errors.New(fmt.Sprintf("Maidenhead grid locator too precise: %q", grid))
+	}
+
+	lonRange, latRange := 360.0, 180.0
+	lonVal, latVal := 0.0, 0.0
+
+	for i := 0; i < nPairs; i++ {
+		p := pairs[i]
+
+		lonRange /= float64(p.divisions)
+		latRange /= float64(p.divisions)
+
+		lonIdx, err := p.decodeChar(grid[2*i])
+		if err != nil {
+			return 0, 0, err
+		}
+		latIdx, err := p.decodeChar(grid[2*i+1])
+		if err != nil {
+			return 0, 0, err
+		}
+
+		lonVal += float64(lonIdx) * lonRange
+		latVal += float64(latIdx) * latRange
+	}
+
+	// Centroid of the final cell.
+	lonVal += lonRange / 2
+	latVal += latRange / 2
+
+	return latVal - 90, lonVal - 180, nil
+}
+
+// decodeChar parses a single grid-locator character for this pair's
+// level, rejecting a character whose index would fall outside the
+// pair's divisions (e.g. 'S'-'Z' at the 18-division field level).
+func (p pair) decodeChar(b byte) (int, error) {
+	var idx int
+
+	if !p.letters {
+		if b < '0' || b > '9' {
+			return 0, errors.New(fmt.Sprintf("Invalid Maidenhead digit: %q", b))
+		}
+		idx = int(b - '0')
+	} else {
+		switch {
+		case b >= 'A' && b <= 'Z':
+			idx = int(b - 'A')
+		case b >= 'a' && b <= 'z':
+			idx = int(b - 'a')
+		default:
+			return 0, errors.New(fmt.Sprintf("Invalid Maidenhead letter: %q", b))
+		}
+	}
+
+	if idx >= p.divisions {
+		return 0, errors.New(fmt.Sprintf("Maidenhead character out of range: %q", b))
+	}
+	return idx, nil
+}
+
+// Lat returns the latitude, in degrees, of the centroid of this
+// Coordinate's grid square.
+func (c Coordinate) Lat() float64 {
+	lat, _, _ := decode(c.Grid)
+	return lat
+}
+
+// Lon returns the longitude, in degrees, of the centroid of this
+// Coordinate's grid square.
+func (c Coordinate) Lon() float64 {
+	_, lon, _ := decode(c.Grid)
+	return lon
+}
+
+// metersPerDegree approximates the length of a degree of latitude, used
+// to turn a grid square's angular size into a linear precision.
+const metersPerDegree = 111320.0
+
+// Precision returns the size, in meters, of the longer side of the grid
+// square represented by this Coordinate's locator, satisfying
+// latlong.Precise.
+func (c Coordinate) Precision() float64 {
+	lonRange, latRange := 360.0, 180.0
+	for i := 0; i < c.CharPrecision()/2 && i < len(pairs); i++ {
+		lonRange /= float64(pairs[i].divisions)
+		latRange /= float64(pairs[i].divisions)
+	}
+
+	latMeters := latRange * metersPerDegree
+	lonMeters := lonRange * metersPerDegree * cosDeg(c.Lat())
+
+	if lonMeters > latMeters {
+		return lonMeters
+	}
+	return latMeters
+}
+
+// CharPrecision returns the number of characters in this Coordinate's
+// grid locator.
+func (c Coordinate) CharPrecision() int {
+	return len(c.Grid)
+}
+
+// validate reports whether s is a well-formed Maidenhead grid locator.
+func validate(s string) error {
+	if len(s) < 2 || len(s)%2 != 0 {
+		return errors.New(fmt.Sprintf("Invalid Maidenhead grid locator: %q", s))
+	}
+	_, _, err := decode(s)
+	return err
+}
+
+// UnmarshalJSON unmarshals a Coordinate from a bare JSON string
+// containing a grid locator, e.g. "CM97cq".
+func (c *Coordinate) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	if err := validate(s); err != nil {
+		return err
+	}
+
+	c.Grid = s
+	return nil
+}
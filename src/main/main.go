@@ -2,14 +2,24 @@ package main
 
 import (
 	"bufio"
+	"container/heap"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"latlong"
+	"latlong/geocode"
+	"latlong/spatial"
 	"log"
+	"maidenhead"
+	"mgrs"
 	"nvector"
 	"os"
+	"osmgraph"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
 	"utm"
 )
 
@@ -17,6 +27,42 @@ var (
 	// True if we want to see debug output, otherwise false.
 	// Set by the user with the -debug flag
 	debug bool
+
+	// True if we want to build a spatial index and offer an interactive
+	// query loop after processing, otherwise false. Set by the user
+	// with the -index flag.
+	indexEnabled bool
+
+	// Path to an OpenStreetMap .osm.pbf file to map-match trips
+	// against, or empty to use the default great-circle distance. Set
+	// by the user with the -mapmatch flag.
+	mapmatchFile string
+
+	// Which latlong.Geocoder implementation to enrich totals with
+	// ("locode", "http", or "" to disable). Set by the user with the
+	// -geocode flag.
+	geocodeKind string
+
+	// Path to the UN/LOCODE CSV file backing the "locode" geocoder.
+	// Set by the user with the -locode-file flag.
+	locodeFile string
+
+	// URL template (with {lat}/{lon} placeholders) backing the "http"
+	// geocoder. Set by the user with the -geocode-url flag.
+	geocodeURL string
+
+	// Number of totals geocoded concurrently. Set by the user with the
+	// -geocode-workers flag.
+	geocodeWorkers int
+
+	// Number of concurrent computeDistances workers processing trips.
+	// Set by the user with the -workers flag.
+	workers int
+
+	// Which runtime/pprof profile, if any, to capture around the
+	// pipeline ("cpu", "mem", or "none"). Set by the user with the
+	// -profile flag.
+	profileMode string
 )
 
 // parseCLIArgs parses options from the command line.
@@ -29,6 +75,14 @@ func parseCLIArgs() string {
 	}
 
 	flag.BoolVar(&debug, "debug", false, "enable debug output")
+	flag.BoolVar(&indexEnabled, "index", false, "build a spatial index and offer an interactive box/near query loop once trips are processed")
+	flag.StringVar(&mapmatchFile, "mapmatch", "", "snap trips to the road graph parsed from this .osm.pbf file and report routed distance instead of great-circle distance")
+	flag.StringVar(&geocodeKind, "geocode", "", "reverse-geocode each trip's start/end place name: \"locode\" or \"http\"")
+	flag.StringVar(&locodeFile, "locode-file", "", "UN/LOCODE CSV file backing -geocode=locode")
+	flag.StringVar(&geocodeURL, "geocode-url", "", "URL template (with {lat}/{lon} placeholders) backing -geocode=http")
+	flag.IntVar(&geocodeWorkers, "geocode-workers", 8, "number of totals geocoded concurrently")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "number of concurrent trip-processing workers")
+	flag.StringVar(&profileMode, "profile", "none", "capture a runtime/pprof profile around the pipeline: \"cpu\", \"mem\", or \"none\"")
 
 	flag.Parse()
 
@@ -38,9 +92,50 @@ func parseCLIArgs() string {
 		os.Exit(1)
 	}
 
+	if workers <= 0 {
+		fmt.Fprintf(os.Stderr, "-workers must be positive, got %d\n\n", workers)
+		flag.Usage()
+		os.Exit(1)
+	}
+	if geocodeWorkers <= 0 {
+		fmt.Fprintf(os.Stderr, "-geocode-workers must be positive, got %d\n\n", geocodeWorkers)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	return flag.Arg(0)
 }
 
+// newGeocoder builds the latlong.Geocoder selected by the -geocode
+// flag, wrapped in a disk-backed LRU cache, or returns nil if
+// reverse geocoding was not requested.
+func newGeocoder() (latlong.Geocoder, error) {
+	var g latlong.Geocoder
+
+	switch geocodeKind {
+	case "":
+		return nil, nil
+	case "locode":
+		if locodeFile == "" {
+			return nil, errors.New("-geocode=locode requires -locode-file")
+		}
+		lg, err := geocode.NewLocodeGeocoder(locodeFile)
+		if err != nil {
+			return nil, err
+		}
+		g = lg
+	case "http":
+		if geocodeURL == "" {
+			return nil, errors.New("-geocode=http requires -geocode-url")
+		}
+		g = geocode.NewHTTPGeocoder(geocodeURL)
+	default:
+		return nil, errors.New("unknown -geocode value: " + geocodeKind)
+	}
+
+	return geocode.NewCaching(g, ".geocode-cache", 10000)
+}
+
 // unmarshalLatLonger attempts to unmarshal a JSON encoded
 // latlong.LatLonger coordinate.
 func unmarshalLatLonger(s string) (l latlong.LatLonger, err error) {
@@ -49,6 +144,8 @@ func unmarshalLatLonger(s string) (l latlong.LatLonger, err error) {
 	var u utm.Coordinate
 	var lt latlong.Coordinate
 	var n nvector.Coordinate
+	var mh maidenhead.Coordinate
+	var m mgrs.Coordinate
 
 	// Check if it is a latlong.Coordinate
 	if err := json.Unmarshal([]byte(s), &lt); err == nil {
@@ -71,13 +168,30 @@ func unmarshalLatLonger(s string) (l latlong.LatLonger, err error) {
 		fmt.Println(err)
 	}
 
+	// Check if it is a maidenhead.Coordinate
+	if err := json.Unmarshal([]byte(s), &mh); err == nil {
+		return mh, nil
+	} else if debug {
+		fmt.Println(err)
+	}
+
+	// Check if it is an mgrs.Coordinate
+	if err := json.Unmarshal([]byte(s), &m); err == nil {
+		return m, nil
+	} else if debug {
+		fmt.Println(err)
+	}
+
 	// Return error if none of the above.
 	return nil, errors.New("Cannot unmarshal coordinate: " + s)
 }
 
 // loadTrips loads trip information line-by-line from a file and sends
-// results over a channel.
-func loadTrips(fname string, trips chan trip) {
+// results over a channel. A line that cannot be parsed does not abort
+// the program: its error is sent on errs instead, and loadTrips
+// continues with the next line. Both trips and errs are closed once the
+// file is exhausted.
+func loadTrips(fname string, trips chan trip, errs chan error) {
 
 	// Try to open the 'fname' file.
 	if file, err := os.Open(fname); err != nil {
@@ -92,7 +206,12 @@ func loadTrips(fname string, trips chan trip) {
 		scanner := bufio.NewScanner(file)
 
 		// Temporary trip for sending over channel.
-		var tmp = trip{0, nil}
+		var tmp = trip{0, 0, nil}
+
+		// nextSeq is the sequence number of the next trip sent on trips,
+		// counting up from 0 regardless of trip id, so collectInOrder can
+		// restore this order downstream of concurrent workers.
+		nextSeq := 0
 
 		// Loop through each line of the fname file.
 		for scanner.Scan() {
@@ -105,15 +224,18 @@ func loadTrips(fname string, trips chan trip) {
 			var js string
 
 			// Extract the info from the line.
-			fmt.Sscanf(line, "%d\t%s", &id, &js)
+			if _, err := fmt.Sscanf(line, "%d\t%s", &id, &js); err != nil {
+				errs <- errors.New(fmt.Sprintf("malformed line %q: %v", line, err))
+				continue
+			}
 
 			// Unpack the latlong.LatLonger and error.
 			l, e := unmarshalLatLonger(js)
 
-			// Exit the program if there is an error.
+			// Report the error and skip this line instead of exiting.
 			if e != nil {
-				fmt.Fprintln(os.Stderr, e)
-				os.Exit(1)
+				errs <- e
+				continue
 			}
 
 			// If still on the same id,
@@ -122,7 +244,9 @@ func loadTrips(fname string, trips chan trip) {
 				tmp.trajectory = append(tmp.trajectory, l)
 			} else { // Otherwise send off the trip and reset tmp.
 				trips <- tmp
+				nextSeq++
 				tmp.id = id
+				tmp.seq = nextSeq
 				tmp.trajectory = nil
 				tmp.trajectory = append(tmp.trajectory, l)
 			}
@@ -132,25 +256,237 @@ func loadTrips(fname string, trips chan trip) {
 	}
 
 	close(trips)
+	close(errs)
 }
 
 // computeDistances continually receives trips over a channel and
 // computes the total travel distance for each trip, sending the
-// totalled results over a channel.
-func computeDistances(trips chan trip, totals chan total) {
+// totalled results over a channel. When idx is non-nil, every point is
+// also streamed into the spatial index as it is visited. When graph is
+// non-nil, the trip is snapped onto the road graph and the routed
+// distance is reported instead of the straight-line great-circle sum.
+// captureEndpoints controls whether a trip's first and last points are
+// recorded on its total, which only geocodeTotals downstream needs;
+// callers should pass true only when reverse geocoding is enabled.
+//
+// computeDistances is meant to be run as one of several concurrent
+// workers sharing trips and totals: it does not close totals when
+// trips is exhausted, since other workers may still be sending to it.
+// The caller is responsible for closing totals once every worker has
+// returned.
+func computeDistances(trips chan trip, totals chan total, idx *spatial.Index, graph *osmgraph.Graph, captureEndpoints bool) {
 	for t := range trips {
 		// Reset dist to 0 for each new trip t.
 		var dist float64 = 0
 
-		// Add up total distance.
-		for i := 0; i < len(t.trajectory)-1; i++ {
-			dist += latlong.Distance(t.trajectory[i], t.trajectory[i+1])
+		// Add up total distance, tracking the coarsest precision (the
+		// largest uncertainty, in meters) among any points that report one.
+		var worstPrecisionM float64 = 0
+		for i, point := range t.trajectory {
+			if idx != nil {
+				idx.Insert(t.id, point)
+			}
+			if i > 0 && graph == nil {
+				dist += latlong.Distance(t.trajectory[i-1], point)
+			}
+			if p, ok := point.(latlong.Precise); ok && p.Precision() > worstPrecisionM {
+				worstPrecisionM = p.Precision()
+			}
+		}
+
+		if graph != nil {
+			if routed, ok := graph.Match(t.trajectory); ok {
+				dist = routed / 1000
+			} else {
+				fmt.Fprintf(os.Stderr, "trip %d: could not map-match, falling back to great-circle distance\n", t.id)
+				for i := 1; i < len(t.trajectory); i++ {
+					dist += latlong.Distance(t.trajectory[i-1], t.trajectory[i])
+				}
+			}
+		}
+
+		tot := total{id: t.id, seq: t.seq, dist: dist, uncertaintyKm: worstPrecisionM / 1000}
+		if captureEndpoints && len(t.trajectory) > 0 {
+			tot.start = t.trajectory[0]
+			tot.end = t.trajectory[len(t.trajectory)-1]
 		}
 
 		// Send total over the channel when finished.
-		totals <- total{t.id, dist}
+		totals <- tot
+	}
+}
+
+// totalHeap is a container/heap.Interface of totals ordered by
+// ascending seq, used by collectInOrder to restore a deterministic
+// output order from several concurrent computeDistances workers.
+type totalHeap []total
+
+func (h totalHeap) Len() int            { return len(h) }
+func (h totalHeap) Less(i, j int) bool  { return h[i].seq < h[j].seq }
+func (h totalHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *totalHeap) Push(x interface{}) { *h = append(*h, x.(total)) }
+func (h *totalHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// collectInOrder reads totals produced by several concurrent
+// computeDistances workers, which may complete in any order, and
+// returns a channel that emits them in the order loadTrips originally
+// produced their trips, by seq. seq is known to start at 0 and count
+// up by exactly one per trip, so unlike trip id (which callers are
+// free to assign however they like, and which a racing first arrival
+// cannot be trusted to reveal the minimum of) the next value to emit
+// is always known in advance. Totals are buffered in a min-heap until
+// the next expected seq becomes available; nothing is left stranded in
+// the heap once in is closed, since seq has no gaps.
+func collectInOrder(in chan total) chan total {
+	out := make(chan total)
+
+	go func() {
+		defer close(out)
+
+		h := &totalHeap{}
+		next := 0
+
+		for t := range in {
+			heap.Push(h, t)
+
+			for h.Len() > 0 && (*h)[0].seq == next {
+				out <- heap.Pop(h).(total)
+				next++
+			}
+		}
+	}()
+
+	return out
+}
+
+// geocodeTotals reads totals from in and, for each, resolves its
+// start/end place names through geocoder, writing the enriched totals
+// to the returned channel in the same order they were received. Up to
+// workers totals are geocoded concurrently.
+func geocodeTotals(in chan total, geocoder latlong.Geocoder, workers int) chan total {
+	out := make(chan total)
+
+	go func() {
+		defer close(out)
+
+		// futures preserves arrival order: the consumer below reads
+		// each trip's result in order, even though the goroutines that
+		// compute them may finish out of order.
+		futures := make(chan chan total, workers)
+		sem := make(chan struct{}, workers)
+		var wg sync.WaitGroup
+
+		go func() {
+			defer close(futures)
+			for t := range in {
+				fut := make(chan total, 1)
+				futures <- fut
+
+				sem <- struct{}{}
+				wg.Add(1)
+				go func(t total) {
+					defer wg.Done()
+					defer func() { <-sem }()
+					fut <- geocodeOne(t, geocoder)
+				}(t)
+			}
+			wg.Wait()
+		}()
+
+		for fut := range futures {
+			out <- <-fut
+		}
+	}()
+
+	return out
+}
+
+// geocodeOne resolves t's start and end place names, if t has a
+// trajectory. Geocoding errors are reported to stderr and otherwise
+// ignored, leaving the corresponding Place zero-valued.
+func geocodeOne(t total, geocoder latlong.Geocoder) total {
+	if t.start == nil || t.end == nil {
+		return t
+	}
+
+	if p, err := geocoder.ReverseGeocode(latlong.Coordinate{Latitude: t.start.Lat(), Longitude: t.start.Lon()}); err == nil {
+		t.startPlace = p
+	} else {
+		fmt.Fprintf(os.Stderr, "trip %d: could not geocode start: %v\n", t.id, err)
+	}
+
+	if p, err := geocoder.ReverseGeocode(latlong.Coordinate{Latitude: t.end.Lat(), Longitude: t.end.Lon()}); err == nil {
+		t.endPlace = p
+	} else {
+		fmt.Fprintf(os.Stderr, "trip %d: could not geocode end: %v\n", t.id, err)
+	}
+
+	return t
+}
+
+// runIndexQueries opens an interactive stdin loop for querying idx.
+// Supported commands:
+//
+//	box lat1,lon1 lat2,lon2   list trips with a point inside the box
+//	near lat,lon km           list trips with a point within km of lat,lon
+func runIndexQueries(idx *spatial.Index) {
+	fmt.Println("Enter 'box lat1,lon1 lat2,lon2' or 'near lat,lon km' (Ctrl-D to quit):")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: box lat1,lon1 lat2,lon2 | near lat,lon km")
+			continue
+		}
+
+		switch fields[0] {
+		case "box":
+			min, err1 := parseCoordinate(fields[1])
+			max, err2 := parseCoordinate(fields[2])
+			if err1 != nil || err2 != nil {
+				fmt.Fprintln(os.Stderr, "usage: box lat1,lon1 lat2,lon2")
+				continue
+			}
+			b, err := spatial.NewBox(min, max)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			fmt.Println(idx.Query(b))
+
+		case "near":
+			center, err := parseCoordinate(fields[1])
+			var km float64
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "usage: near lat,lon km")
+				continue
+			}
+			if _, err := fmt.Sscanf(fields[2], "%g", &km); err != nil {
+				fmt.Fprintln(os.Stderr, "usage: near lat,lon km")
+				continue
+			}
+			fmt.Println(idx.Near(center, km))
+
+		default:
+			fmt.Fprintln(os.Stderr, "usage: box lat1,lon1 lat2,lon2 | near lat,lon km")
+		}
+	}
+}
+
+// parseCoordinate parses a "lat,lon" pair into a latlong.Coordinate.
+func parseCoordinate(s string) (latlong.Coordinate, error) {
+	var lat, lon float64
+	if _, err := fmt.Sscanf(s, "%g,%g", &lat, &lon); err != nil {
+		return latlong.Coordinate{}, err
 	}
-	close(totals)
+	return latlong.Coordinate{Latitude: lat, Longitude: lon}, nil
 }
 
 func main() {
@@ -161,17 +497,114 @@ func main() {
 		log.Printf("Starting program %s", os.Args[0])
 	}
 
+	if profileMode == "cpu" {
+		f, err := os.Create("cpu.prof")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
 	// Initialized necessary channels.
 	trips_chan := make(chan trip)
 	totals_chan := make(chan total)
+	errs_chan := make(chan error)
+
+	// Build a spatial index alongside distance computation if requested.
+	var idx *spatial.Index
+	if indexEnabled {
+		idx = spatial.NewIndex()
+	}
+
+	// Parse the road graph up front if map-matching was requested.
+	var graph *osmgraph.Graph
+	if mapmatchFile != "" {
+		g, err := osmgraph.BuildCached(mapmatchFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		graph = g
+	}
+
+	// Build the reverse geocoder, if requested.
+	geocoder, err := newGeocoder()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// Spin up the producer and a pool of workers that consume trips_chan
+	// in parallel; totals_chan is closed once every worker has returned.
+	go loadTrips(fname, trips_chan, errs_chan)
+
+	var workerWg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		workerWg.Add(1)
+		go func() {
+			defer workerWg.Done()
+			computeDistances(trips_chan, totals_chan, idx, graph, geocoder != nil)
+		}()
+	}
+	go func() {
+		workerWg.Wait()
+		close(totals_chan)
+	}()
+
+	// Restore a deterministic trip order, since workers may finish out
+	// of order.
+	ordered := collectInOrder(totals_chan)
+
+	// Enrich totals with place names concurrently, if requested,
+	// without disturbing their order.
+	results := ordered
+	if geocoder != nil {
+		results = geocodeTotals(ordered, geocoder, geocodeWorkers)
+	}
 
-	// Spin up goroutines
-	go loadTrips(fname, trips_chan)
-	go computeDistances(trips_chan, totals_chan)
+	// Drain malformed-line errors concurrently with the rest of the
+	// pipeline, so neither blocks on the other.
+	var badLines int
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for e := range errs_chan {
+			fmt.Fprintln(os.Stderr, e)
+			badLines++
+		}
+	}()
 
 	// Output totals until channel is closed.
-	for tot := range totals_chan {
+	for tot := range results {
 		fmt.Println(tot)
 	}
+	<-errsDone
+
+	if badLines > 0 {
+		fmt.Fprintf(os.Stderr, "%d malformed line(s) skipped\n", badLines)
+	}
+
+	if profileMode == "mem" {
+		f, err := os.Create("mem.prof")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
+	if indexEnabled {
+		runIndexQueries(idx)
+	}
 }
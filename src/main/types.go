@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"latlong"
+)
+
+// trip is a single numbered trajectory made up of the points visited,
+// in order.
+//
+// seq is the position at which loadTrips produced this trip, counting
+// up from 0 regardless of the trip's own id. It lets collectInOrder
+// restore loadTrips' original order even though several computeDistances
+// workers may finish trips out of order.
+type trip struct {
+	id         int
+	seq        int
+	trajectory []latlong.LatLonger
+}
+
+// total is the computed travel distance, in kilometers, for a trip.
+//
+// seq is copied from the source trip's seq, for collectInOrder.
+//
+// uncertaintyKm is the +/- uncertainty band, in kilometers, contributed
+// by the coarsest latlong.Precise point in the trip's trajectory. It is
+// zero when no point in the trajectory reports a bounded precision.
+//
+// start, end, startPlace, and endPlace are only populated when reverse
+// geocoding is enabled; start and end are nil otherwise.
+type total struct {
+	id            int
+	seq           int
+	dist          float64
+	uncertaintyKm float64
+	start, end    latlong.LatLonger
+	startPlace    latlong.Place
+	endPlace      latlong.Place
+}
+
+// String formats a total for printing. Place names are only appended
+// when reverse geocoding populated them, so runs without -geocode keep
+// the plain (id, distance, uncertainty) output.
+func (t total) String() string {
+	s := fmt.Sprintf("{%d %v %v}", t.id, t.dist, t.uncertaintyKm)
+	if t.startPlace == (latlong.Place{}) && t.endPlace == (latlong.Place{}) {
+		return s
+	}
+	return fmt.Sprintf("%s %v -> %v", s, t.startPlace, t.endPlace)
+}
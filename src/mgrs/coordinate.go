@@ -0,0 +1,240 @@
+// Package mgrs is a bidirectional Military Grid Reference System
+// converter for go, built on top of package utm.
+//
+// Reference for MGRS can be found here:
+//   - https://en.wikipedia.org/wiki/Military_Grid_Reference_System
+package mgrs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"latlong"
+	"utm"
+)
+
+// columnLetters and rowLetters are the 100,000m square identification
+// letters. 'I' and 'O' are skipped throughout MGRS to avoid confusion
+// with '1' and '0'.
+const (
+	columnLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	rowLetters    = "ABCDEFGHJKLMNPQRSTUV"
+
+	squareSize = 100000.0  // meters
+	rowCycle   = 2000000.0 // meters; 20 rows of 100,000m before letters repeat
+)
+
+// DefaultDigits is the per-axis digit count of the finest supported
+// precision (1 meter). FromUTM always takes its precision explicitly.
+const DefaultDigits = 5
+
+// Coordinate represents a position on earth as a Military Grid
+// Reference System string, e.g. "4QFJ1234567890".
+type Coordinate struct {
+	Zone     int
+	Band     byte
+	Square   string // two-letter 100,000m square identifier
+	Easting  int    // meters east of the square's origin
+	Northing int    // meters north of the square's origin
+	Digits   int    // digits used per axis (0-5; 0 names only the 100,000m square)
+}
+
+// FromUTM converts a utm.Coordinate to its corresponding MGRS
+// Coordinate, truncated to the given precision in meters. precision
+// must be one of 1, 10, 100, 1000, or 10000.
+func FromUTM(u utm.Coordinate, precision int) (Coordinate, error) {
+	digits, err := digitsForPrecision(precision)
+	if err != nil {
+		return Coordinate{}, err
+	}
+
+	col := int(u.Easting/squareSize) - 1
+	set := (u.Zone - 1) % 3
+	colLetter := columnLetters[set*8+col]
+
+	rowIdx := int(u.Northing/squareSize) % len(rowLetters)
+	if u.Zone%2 == 0 {
+		rowIdx = (rowIdx + 5) % len(rowLetters)
+	}
+	rowLetter := rowLetters[rowIdx]
+
+	scale := pow10(5 - digits)
+	easting := int(u.Easting) % int(squareSize) / scale
+	northing := int(u.Northing) % int(squareSize) / scale
+
+	return Coordinate{
+		Zone:     u.Zone,
+		Band:     u.Band,
+		Square:   string([]byte{colLetter, rowLetter}),
+		Easting:  easting,
+		Northing: northing,
+		Digits:   digits,
+	}, nil
+}
+
+// ToUTM converts a Coordinate back to a utm.Coordinate. Because an MGRS
+// square identifier repeats every 2,000,000m of northing, the nearest
+// candidate to the Coordinate's latitude Band is chosen.
+func ToUTM(c Coordinate) utm.Coordinate {
+	col := indexByte(columnLetters, c.Square[0])
+	set := (c.Zone - 1) % 3
+	easting := float64(col-set*8+1)*squareSize + float64(c.Easting*pow10(5-c.Digits))
+
+	rowIdx := indexByte(rowLetters, c.Square[1])
+	if c.Zone%2 == 0 {
+		rowIdx = (rowIdx - 5 + len(rowLetters)) % len(rowLetters)
+	}
+
+	northing := nearestNorthing(rowIdx, c.Band) + float64(c.Northing*pow10(5-c.Digits))
+
+	return utm.Coordinate{Zone: c.Zone, Band: c.Band, Easting: easting, Northing: northing}
+}
+
+// nearestNorthing finds the multiple of rowCycle offset by rowIdx*100,000m
+// that falls within the approximate northing range of band.
+func nearestNorthing(rowIdx int, band byte) float64 {
+	base := float64(rowIdx) * squareSize
+	approx := approxNorthing(band)
+
+	best, bestDist := base, diff(base, approx)
+	for k := 1; k <= 5; k++ {
+		for _, candidate := range []float64{base + float64(k)*rowCycle, base - float64(k)*rowCycle} {
+			if d := diff(candidate, approx); d < bestDist {
+				best, bestDist = candidate, d
+			}
+		}
+	}
+	return best
+}
+
+func diff(a, b float64) float64 {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
+
+// approxNorthing estimates the UTM northing, in meters, of the center
+// of a latitude band, assuming an equatorial scale of 111,320m/degree.
+func approxNorthing(band byte) float64 {
+	idx := indexByte(utmBandLetters, band)
+	lat := float64(idx)*8 - 80 + 4 // center of the 8-degree band
+	n := lat * 111320.0
+	if n < 0 {
+		n += 10000000.0
+	}
+	return n
+}
+
+// utmBandLetters mirrors the band letters used by package utm.
+const utmBandLetters = "CDEFGHJKLMNPQRSTUVWXX"
+
+func indexByte(s string, b byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+func digitsForPrecision(precision int) (int, error) {
+	switch precision {
+	case 1:
+		return 5, nil
+	case 10:
+		return 4, nil
+	case 100:
+		return 3, nil
+	case 1000:
+		return 2, nil
+	case 10000:
+		return 1, nil
+	default:
+		return 0, errors.New(fmt.Sprintf("Unsupported MGRS precision: %d", precision))
+	}
+}
+
+func pow10(n int) int {
+	r := 1
+	for i := 0; i < n; i++ {
+		r *= 10
+	}
+	return r
+}
+
+// Lat returns the latitude, in degrees, of this Coordinate.
+func (c Coordinate) Lat() float64 {
+	return ToUTM(c).Lat()
+}
+
+// Lon returns the longitude, in degrees, of this Coordinate.
+func (c Coordinate) Lon() float64 {
+	return ToUTM(c).Lon()
+}
+
+// Precision returns the size, in meters, of the square this Coordinate
+// identifies, satisfying latlong.Precise.
+func (c Coordinate) Precision() float64 {
+	return float64(pow10(5 - c.Digits))
+}
+
+var _ latlong.Precise = Coordinate{}
+
+// parse decodes an MGRS string into its component fields.
+func parse(s string) (Coordinate, error) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == 0 || i > 2 || i+3 > len(s) {
+		return Coordinate{}, errors.New(fmt.Sprintf("Invalid MGRS coordinate: %q", s))
+	}
+
+	zone := 0
+	fmt.Sscanf(s[:i], "%d", &zone)
+	band := s[i]
+
+	square := s[i+1 : i+3]
+	if len(square) != 2 {
+		return Coordinate{}, errors.New(fmt.Sprintf("Invalid MGRS 100,000m square id: %q", s))
+	}
+
+	digitsStr := s[i+3:]
+	if len(digitsStr)%2 != 0 || len(digitsStr) > 10 {
+		return Coordinate{}, errors.New(fmt.Sprintf("Invalid MGRS numerical location: %q", s))
+	}
+
+	digits := len(digitsStr) / 2
+	var easting, northing int
+	if digits > 0 {
+		fmt.Sscanf(digitsStr[:digits], "%d", &easting)
+		fmt.Sscanf(digitsStr[digits:], "%d", &northing)
+	}
+
+	return Coordinate{
+		Zone:     zone,
+		Band:     band,
+		Square:   square,
+		Easting:  easting,
+		Northing: northing,
+		Digits:   digits,
+	}, nil
+}
+
+// UnmarshalJSON unmarshals a Coordinate from a bare JSON string
+// containing an MGRS coordinate, e.g. "4QFJ1234567890".
+func (c *Coordinate) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := parse(s)
+	if err != nil {
+		return err
+	}
+
+	*c = parsed
+	return nil
+}
@@ -0,0 +1,120 @@
+package osmgraph
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"latlong"
+	"os"
+	"path/filepath"
+)
+
+// cachedEdge and cachedGraph mirror edge and Graph with exported
+// fields, since encoding/gob only ever encodes exported fields, even
+// within the same package.
+type cachedEdge struct {
+	To     int64
+	Meters float64
+}
+
+type cachedGraph struct {
+	Nodes     map[int64]latlong.Coordinate
+	Adjacency map[int64][]cachedEdge
+}
+
+// BuildCached behaves like Build, but reuses a previously built Graph
+// from disk when one exists for this exact PBF file, keyed by the
+// file's sha256 hash. The cache lives alongside the source file with a
+// ".graphcache" suffix.
+func BuildCached(path string) (*Graph, error) {
+	hash, err := fileHash(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cachePath := cachePathFor(path, hash)
+
+	if g, err := loadCache(cachePath); err == nil {
+		return g, nil
+	}
+
+	g, err := Build(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A failure to persist the cache should not fail the build.
+	_ = saveCache(cachePath, g)
+
+	return g, nil
+}
+
+func cachePathFor(path, hash string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.graphcache", hash))
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func loadCache(cachePath string) (*Graph, error) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cg cachedGraph
+	if err := gob.NewDecoder(f).Decode(&cg); err != nil {
+		return nil, err
+	}
+
+	g := &Graph{
+		nodes:     make(map[int64]latlong.Coordinate, len(cg.Nodes)),
+		adjacency: make(map[int64][]edge, len(cg.Adjacency)),
+	}
+	for id, c := range cg.Nodes {
+		g.nodes[id] = c
+	}
+	for id, edges := range cg.Adjacency {
+		for _, e := range edges {
+			g.adjacency[id] = append(g.adjacency[id], edge{to: e.To, meters: e.Meters})
+		}
+	}
+	g.buildNodeLocator()
+	return g, nil
+}
+
+func saveCache(cachePath string, g *Graph) error {
+	f, err := os.Create(cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cg := cachedGraph{
+		Nodes:     make(map[int64]latlong.Coordinate, len(g.nodes)),
+		Adjacency: make(map[int64][]cachedEdge, len(g.adjacency)),
+	}
+	for id, c := range g.nodes {
+		cg.Nodes[id] = c
+	}
+	for id, edges := range g.adjacency {
+		for _, e := range edges {
+			cg.Adjacency[id] = append(cg.Adjacency[id], cachedEdge{To: e.to, Meters: e.meters})
+		}
+	}
+
+	return gob.NewEncoder(f).Encode(cg)
+}
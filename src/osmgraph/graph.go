@@ -0,0 +1,261 @@
+// Package osmgraph builds a routable road graph from an OpenStreetMap
+// PBF extract and supports snapping latlong.LatLonger points to the
+// graph and routing distances along it (as opposed to the straight-line
+// great-circle distances latlong.Distance reports).
+package osmgraph
+
+import (
+	"container/heap"
+	"latlong"
+	"latlong/spatial"
+	"math"
+	"sort"
+)
+
+// edge is one directed connection from a node to a neighboring node,
+// weighted by great-circle distance in meters.
+type edge struct {
+	to     int64
+	meters float64
+}
+
+// Graph is an adjacency-list road graph built from the highway=* ways
+// of an OSM PBF extract.
+type Graph struct {
+	nodes     map[int64]latlong.Coordinate
+	adjacency map[int64][]edge
+
+	// nodeIDs and nodeLocator together let Snap and candidates find
+	// nearby nodes through nodeLocator's geohash buckets instead of
+	// ranging over nodes (a graph that lies within a single bucket still
+	// has every node checked): nodeLocator is a
+	// spatial.Index over nodeIDs' positions (spatial.Index identifies
+	// points by an int, and an OSM node id is an int64, so the slice
+	// position stands in for the id and nodeIDs maps it back).
+	nodeIDs     []int64
+	nodeLocator *spatial.Index
+}
+
+// Build streams path's ways and nodes into a new Graph.
+func Build(path string) (*Graph, error) {
+	g := &Graph{
+		nodes:     make(map[int64]latlong.Coordinate),
+		adjacency: make(map[int64][]edge),
+	}
+
+	err := ParseFile(path,
+		func(n Node) {
+			g.nodes[n.ID] = latlong.Coordinate{Latitude: n.Lat, Longitude: n.Lon}
+		},
+		func(w Way) {
+			for i := 0; i < len(w.Refs)-1; i++ {
+				g.addWaySegment(w.Refs[i], w.Refs[i+1])
+			}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	g.weighEdges()
+	// Only nodes on a highway way belong to the road graph; drop the
+	// rest so Snap and Match never pick a node with no edges.
+	for id := range g.nodes {
+		if len(g.adjacency[id]) == 0 {
+			delete(g.nodes, id)
+		}
+	}
+	g.buildNodeLocator()
+	return g, nil
+}
+
+// buildNodeLocator (re)builds the spatial index over g.nodes used by
+// Snap and candidates. Callers that populate g.nodes directly, such as
+// loadCache, must call this once before using either.
+func (g *Graph) buildNodeLocator() {
+	g.nodeIDs = make([]int64, 0, len(g.nodes))
+	g.nodeLocator = spatial.NewIndex()
+	for id, coord := range g.nodes {
+		g.nodeLocator.Insert(len(g.nodeIDs), coord)
+		g.nodeIDs = append(g.nodeIDs, id)
+	}
+}
+
+// addWaySegment records a bidirectional edge between two way nodes.
+// The actual meter weight is filled in lazily by weighEdges, once all
+// node coordinates have been read, since PBF blocks may interleave
+// ways before the nodes they reference.
+func (g *Graph) addWaySegment(a, b int64) {
+	g.adjacency[a] = append(g.adjacency[a], edge{to: b})
+	g.adjacency[b] = append(g.adjacency[b], edge{to: a})
+}
+
+// weighEdges fills in edge weights once all nodes are known. Build
+// calls it once, after streaming is complete.
+func (g *Graph) weighEdges() {
+	for from, edges := range g.adjacency {
+		fromCoord, ok := g.nodes[from]
+		if !ok {
+			continue
+		}
+		for i := range edges {
+			toCoord, ok := g.nodes[edges[i].to]
+			if !ok {
+				continue
+			}
+			edges[i].meters = latlong.Distance(fromCoord, toCoord) * 1000
+		}
+	}
+}
+
+// nearbyNode is one graph node found by nearby, with its exact distance
+// from the query point.
+type nearbyNode struct {
+	id     int64
+	meters float64
+}
+
+// nearby returns every graph node within radiusMeters of p, nearest
+// first, as found by nodeLocator.Near, which checks every node in the
+// index buckets it visits.
+func (g *Graph) nearby(p latlong.LatLonger, radiusMeters float64) []nearbyNode {
+	positions := g.nodeLocator.Near(latlong.Coordinate{Latitude: p.Lat(), Longitude: p.Lon()}, radiusMeters/1000)
+
+	found := make([]nearbyNode, 0, len(positions))
+	for _, pos := range positions {
+		id := g.nodeIDs[pos]
+		d := latlong.Distance(p, g.nodes[id]) * 1000
+		if d <= radiusMeters {
+			found = append(found, nearbyNode{id: id, meters: d})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].meters < found[j].meters })
+	return found
+}
+
+// snapSearchRadii are the expanding search radii, in meters, Snap tries
+// in turn until it finds at least one node, so a typical query resolves
+// in one or two narrow, indexed lookups instead of always falling back
+// to a full scan.
+var snapSearchRadii = []float64{200, 1000, 5000, 25000, 125000}
+
+// Snap returns the id of the graph node nearest to p, and its distance
+// from p in meters.
+func (g *Graph) Snap(p latlong.LatLonger) (nodeID int64, dist float64) {
+	for _, radius := range snapSearchRadii {
+		if found := g.nearby(p, radius); len(found) > 0 {
+			return found[0].id, found[0].meters
+		}
+	}
+
+	// The graph is sparser than every radius tried above (or empty):
+	// fall back to an exhaustive scan, which is always correct.
+	best := math.Inf(1)
+	var bestID int64
+	for id, coord := range g.nodes {
+		d := latlong.Distance(p, coord) * 1000
+		if d < best {
+			best, bestID = d, id
+		}
+	}
+	return bestID, best
+}
+
+// Route returns the shortest path distance, in meters, between nodes a
+// and b along the graph, found with Dijkstra's algorithm over a binary
+// heap. ok is false if no path connects them.
+func (g *Graph) Route(a, b int64) (distMeters float64, ok bool) {
+	dist := map[int64]float64{a: 0}
+	visited := make(map[int64]bool)
+
+	pq := &priorityQueue{{node: a, priority: 0}}
+	heap.Init(pq)
+
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(pqItem)
+		if visited[cur.node] {
+			continue
+		}
+		visited[cur.node] = true
+
+		if cur.node == b {
+			return cur.priority, true
+		}
+
+		for _, e := range g.adjacency[cur.node] {
+			if visited[e.to] {
+				continue
+			}
+			next := cur.priority + e.meters
+			if d, ok := dist[e.to]; !ok || next < d {
+				dist[e.to] = next
+				heap.Push(pq, pqItem{node: e.to, priority: next})
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// routeToAll returns the shortest-path distance, in meters, from a to
+// every node in targets that is reachable, found with a single
+// Dijkstra run that stops once every target has been visited (or the
+// frontier is exhausted). Match uses this to score a node's transition
+// to several candidate targets at once: one shared Dijkstra run costs
+// far less than calling Route separately for each (from, to) pair,
+// since Route would re-explore the same frontier from scratch every
+// time.
+func (g *Graph) routeToAll(a int64, targets map[int64]bool) map[int64]float64 {
+	dist := map[int64]float64{a: 0}
+	visited := make(map[int64]bool)
+	found := make(map[int64]float64, len(targets))
+
+	pq := &priorityQueue{{node: a, priority: 0}}
+	heap.Init(pq)
+
+	for pq.Len() > 0 && len(found) < len(targets) {
+		cur := heap.Pop(pq).(pqItem)
+		if visited[cur.node] {
+			continue
+		}
+		visited[cur.node] = true
+
+		if targets[cur.node] {
+			found[cur.node] = cur.priority
+		}
+
+		for _, e := range g.adjacency[cur.node] {
+			if visited[e.to] {
+				continue
+			}
+			next := cur.priority + e.meters
+			if d, ok := dist[e.to]; !ok || next < d {
+				dist[e.to] = next
+				heap.Push(pq, pqItem{node: e.to, priority: next})
+			}
+		}
+	}
+
+	return found
+}
+
+// pqItem is one entry in the Dijkstra priority queue.
+type pqItem struct {
+	node     int64
+	priority float64
+}
+
+// priorityQueue is a container/heap.Interface of pqItems ordered by
+// ascending priority (distance so far).
+type priorityQueue []pqItem
+
+func (pq priorityQueue) Len() int            { return len(pq) }
+func (pq priorityQueue) Less(i, j int) bool  { return pq[i].priority < pq[j].priority }
+func (pq priorityQueue) Swap(i, j int)       { pq[i], pq[j] = pq[j], pq[i] }
+func (pq *priorityQueue) Push(x interface{}) { *pq = append(*pq, x.(pqItem)) }
+func (pq *priorityQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	item := old[n-1]
+	*pq = old[:n-1]
+	return item
+}
@@ -0,0 +1,120 @@
+package osmgraph
+
+import (
+	"latlong"
+	"math"
+)
+
+// MatchRadiusMeters is the default radius, in meters, within which a
+// trajectory point's candidate graph nodes are gathered.
+const MatchRadiusMeters = 200.0
+
+// MatchTopK is the default number of nearest candidate nodes kept per
+// trajectory point.
+const MatchTopK = 5
+
+// Match snaps a trajectory of points onto the graph with a simple
+// HMM-style map matcher: at each point it keeps the nearest
+// MatchTopK candidate nodes within MatchRadiusMeters, scores
+// transitions between consecutive points' candidates by how far the
+// routed distance diverges from the great-circle distance, and
+// Viterbi-decodes the lowest-cost node sequence. It returns the total
+// routed distance, in meters, along that sequence. ok is false if any
+// point has no nearby candidate, or no path connects consecutive
+// candidates.
+func (g *Graph) Match(points []latlong.LatLonger) (distMeters float64, ok bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+
+	cost := map[int64]float64{}
+	for _, c := range g.candidates(points[0], MatchRadiusMeters, MatchTopK) {
+		cost[c] = 0
+	}
+	if len(cost) == 0 {
+		return 0, false
+	}
+
+	backptrs := make([]map[int64]int64, len(points))
+
+	for i := 1; i < len(points); i++ {
+		candidates := g.candidates(points[i], MatchRadiusMeters, MatchTopK)
+		if len(candidates) == 0 {
+			return 0, false
+		}
+
+		greatCircle := latlong.Distance(points[i-1], points[i]) * 1000
+
+		targets := make(map[int64]bool, len(candidates))
+		for _, c := range candidates {
+			targets[c] = true
+		}
+
+		nextCost := make(map[int64]float64)
+		back := make(map[int64]int64)
+
+		// One routeToAll run per prev resolves its distance to every
+		// candidate at once, rather than a separate Dijkstra run per
+		// (prev, candidate) pair.
+		for prev, prevCost := range cost {
+			routed := g.routeToAll(prev, targets)
+			for _, c := range candidates {
+				d, ok := routed[c]
+				if !ok {
+					continue
+				}
+				total := prevCost + math.Abs(d-greatCircle)
+				if cur, exists := nextCost[c]; !exists || total < cur {
+					nextCost[c] = total
+					back[c] = prev
+				}
+			}
+		}
+
+		if len(nextCost) == 0 {
+			return 0, false
+		}
+		backptrs[i] = back
+		cost = nextCost
+	}
+
+	var bestNode int64
+	bestCost := math.Inf(1)
+	for node, c := range cost {
+		if c < bestCost {
+			bestCost, bestNode = c, node
+		}
+	}
+
+	nodes := make([]int64, len(points))
+	nodes[len(points)-1] = bestNode
+	for i := len(points) - 1; i > 0; i-- {
+		nodes[i-1] = backptrs[i][nodes[i]]
+	}
+
+	var total float64
+	for i := 1; i < len(nodes); i++ {
+		d, ok := g.Route(nodes[i-1], nodes[i])
+		if !ok {
+			return 0, false
+		}
+		total += d
+	}
+	return total, true
+}
+
+// candidates returns the ids of up to k graph nodes nearest p, among
+// those within radiusMeters, nearest first. It uses g.nearby, so it
+// costs one nodeLocator range query.
+func (g *Graph) candidates(p latlong.LatLonger, radiusMeters float64, k int) []int64 {
+	found := g.nearby(p, radiusMeters)
+	if len(found) > k {
+		found = found[:k]
+	}
+
+	ids := make([]int64, len(found))
+	for i, n := range found {
+		ids[i] = n.id
+	}
+	return ids
+}
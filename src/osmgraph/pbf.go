@@ -0,0 +1,441 @@
+package osmgraph
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Node is a single OSM node, decoded from a PBF DenseNodes block.
+type Node struct {
+	ID  int64
+	Lat float64
+	Lon float64
+}
+
+// Way is a single OSM way tagged highway=*, decoded from a PBF Way
+// block. Refs are node ids, in order.
+type Way struct {
+	ID      int64
+	Refs    []int64
+	Highway string
+}
+
+// ParseFile streams nodes and ways=highway out of an OSM .osm.pbf
+// file, calling onNode/onWay as each is decoded so the whole file
+// never has to be held in memory at once. Only DenseNodes-encoded
+// nodes are supported, which covers every PBF extract produced by the
+// common OSM toolchain (osmium, osmconvert, Osmosis).
+func ParseFile(path string, onNode func(Node), onWay func(Way)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		header, blobType, err := readBlobHeader(f)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		blob := make([]byte, header.DataSize)
+		if _, err := io.ReadFull(f, blob); err != nil {
+			return err
+		}
+
+		if blobType != "OSMData" {
+			continue // skip the OSMHeader blob
+		}
+
+		data, err := decodeBlob(blob)
+		if err != nil {
+			return err
+		}
+		if err := parsePrimitiveBlock(data, onNode, onWay); err != nil {
+			return err
+		}
+	}
+}
+
+// blobHeader is the subset of fields.proto's BlobHeader message we
+// need: the blob's declared type and its byte length.
+type blobHeader struct {
+	DataSize int
+}
+
+// readBlobHeader reads the 4-byte big-endian length prefix followed by
+// the BlobHeader protobuf message.
+func readBlobHeader(r io.Reader) (blobHeader, string, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return blobHeader{}, "", err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return blobHeader{}, "", err
+	}
+
+	pr := newPBReader(buf)
+	var h blobHeader
+	var typ string
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1: // type
+			b, err := pr.bytesField()
+			if err != nil {
+				return blobHeader{}, "", err
+			}
+			typ = string(b)
+		case 3: // datasize
+			v, err := pr.varint()
+			if err != nil {
+				return blobHeader{}, "", err
+			}
+			h.DataSize = int(v)
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return blobHeader{}, "", err
+			}
+		}
+	}
+	return h, typ, nil
+}
+
+// decodeBlob extracts and, if necessary, inflates a Blob message's
+// payload.
+func decodeBlob(buf []byte) ([]byte, error) {
+	pr := newPBReader(buf)
+	var raw, zlibData []byte
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1: // raw
+			b, err := pr.bytesField()
+			if err != nil {
+				return nil, err
+			}
+			raw = b
+		case 3: // zlib_data
+			b, err := pr.bytesField()
+			if err != nil {
+				return nil, err
+			}
+			zlibData = b
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if raw != nil {
+		return raw, nil
+	}
+	if zlibData == nil {
+		return nil, errors.New("osmgraph: blob has neither raw nor zlib_data")
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(zlibData))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+// parsePrimitiveBlock decodes a PrimitiveBlock message, streaming its
+// nodes and highway ways out via onNode/onWay.
+func parsePrimitiveBlock(buf []byte, onNode func(Node), onWay func(Way)) error {
+	pr := newPBReader(buf)
+
+	var stringtable [][]byte
+	var groups [][]byte
+	granularity := int64(100)
+	latOffset, lonOffset := int64(0), int64(0)
+
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1: // stringtable
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			st, err := parseStringTable(b)
+			if err != nil {
+				return err
+			}
+			stringtable = st
+		case 2: // primitivegroup
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			groups = append(groups, b)
+		case 17: // granularity
+			v, err := pr.varint()
+			if err != nil {
+				return err
+			}
+			granularity = int64(v)
+		case 19: // lat_offset
+			v, err := pr.varint()
+			if err != nil {
+				return err
+			}
+			latOffset = int64(v)
+		case 20: // lon_offset
+			v, err := pr.varint()
+			if err != nil {
+				return err
+			}
+			lonOffset = int64(v)
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, g := range groups {
+		if err := parsePrimitiveGroup(g, stringtable, granularity, latOffset, lonOffset, onNode, onWay); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseStringTable(buf []byte) ([][]byte, error) {
+	pr := newPBReader(buf)
+	var out [][]byte
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		if field != 1 {
+			if err := pr.skipField(wt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b, err := pr.bytesField()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func parsePrimitiveGroup(buf []byte, stringtable [][]byte, granularity, latOffset, lonOffset int64, onNode func(Node), onWay func(Way)) error {
+	pr := newPBReader(buf)
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 2: // dense
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			if err := parseDenseNodes(b, granularity, latOffset, lonOffset, onNode); err != nil {
+				return err
+			}
+		case 3: // ways
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			w, err := parseWay(b, stringtable)
+			if err != nil {
+				return err
+			}
+			if w.Highway != "" {
+				onWay(w)
+			}
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseDenseNodes(buf []byte, granularity, latOffset, lonOffset int64, onNode func(Node)) error {
+	pr := newPBReader(buf)
+	var ids, lats, lons []int64
+
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1: // id, packed sint64 delta
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			raw, err := packedVarints(b)
+			if err != nil {
+				return err
+			}
+			ids = zigzagAll(raw)
+		case 8: // lat, packed sint64 delta
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			raw, err := packedVarints(b)
+			if err != nil {
+				return err
+			}
+			lats = zigzagAll(raw)
+		case 9: // lon, packed sint64 delta
+			b, err := pr.bytesField()
+			if err != nil {
+				return err
+			}
+			raw, err := packedVarints(b)
+			if err != nil {
+				return err
+			}
+			lons = zigzagAll(raw)
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return err
+			}
+		}
+	}
+
+	n := len(ids)
+	if len(lats) < n {
+		n = len(lats)
+	}
+	if len(lons) < n {
+		n = len(lons)
+	}
+
+	var id, lat, lon int64
+	for i := 0; i < n; i++ {
+		id += ids[i]
+		lat += lats[i]
+		lon += lons[i]
+		onNode(Node{
+			ID:  id,
+			Lat: float64(latOffset+granularity*lat) / 1e9,
+			Lon: float64(lonOffset+granularity*lon) / 1e9,
+		})
+	}
+	return nil
+}
+
+func parseWay(buf []byte, stringtable [][]byte) (Way, error) {
+	pr := newPBReader(buf)
+	var w Way
+	var keys, vals []uint32
+	var refDeltas []int64
+
+	for {
+		field, wt, ok := pr.next()
+		if !ok {
+			break
+		}
+		switch field {
+		case 1: // id
+			v, err := pr.varint()
+			if err != nil {
+				return Way{}, err
+			}
+			w.ID = int64(v)
+		case 2: // keys
+			b, err := pr.bytesField()
+			if err != nil {
+				return Way{}, err
+			}
+			keys, err = packedUint32s(b)
+			if err != nil {
+				return Way{}, err
+			}
+		case 3: // vals
+			b, err := pr.bytesField()
+			if err != nil {
+				return Way{}, err
+			}
+			vals, err = packedUint32s(b)
+			if err != nil {
+				return Way{}, err
+			}
+		case 8: // refs, packed sint64 delta
+			b, err := pr.bytesField()
+			if err != nil {
+				return Way{}, err
+			}
+			raw, err := packedVarints(b)
+			if err != nil {
+				return Way{}, err
+			}
+			refDeltas = zigzagAll(raw)
+		default:
+			if err := pr.skipField(wt); err != nil {
+				return Way{}, err
+			}
+		}
+	}
+
+	var ref int64
+	for _, d := range refDeltas {
+		ref += d
+		w.Refs = append(w.Refs, ref)
+	}
+
+	for i := 0; i < len(keys) && i < len(vals); i++ {
+		if int(keys[i]) >= len(stringtable) || int(vals[i]) >= len(stringtable) {
+			continue
+		}
+		if string(stringtable[keys[i]]) == "highway" {
+			w.Highway = string(stringtable[vals[i]])
+		}
+	}
+
+	if w.Highway == "" {
+		return w, nil
+	}
+	if len(w.Refs) < 2 {
+		return Way{}, errors.New(fmt.Sprintf("osmgraph: way %d tagged highway has fewer than 2 nodes", w.ID))
+	}
+	return w, nil
+}
+
+func zigzagAll(vs []int64) []int64 {
+	out := make([]int64, len(vs))
+	for i, v := range vs {
+		out[i] = zigzag(v)
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package osmgraph
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A minimal streaming protobuf field reader, just capable enough to
+// decode the handful of message shapes used by the OSM PBF format
+// (https://wiki.openstreetmap.org/wiki/PBF_Format): varints, 32/64-bit
+// fixed fields, and length-delimited fields (strings, bytes, packed
+// repeated fields, and embedded messages).
+
+// wireType identifies how a protobuf field's value is encoded.
+type wireType int
+
+const (
+	wireVarint  wireType = 0
+	wireFixed64 wireType = 1
+	wireBytes   wireType = 2
+	wireFixed32 wireType = 5
+)
+
+// pbReader walks the fields of a single protobuf message.
+type pbReader struct {
+	buf []byte
+	pos int
+}
+
+func newPBReader(buf []byte) *pbReader {
+	return &pbReader{buf: buf}
+}
+
+// next returns the field number and wire type of the next field, or
+// ok=false once the message is exhausted.
+func (r *pbReader) next() (field int, wt wireType, ok bool) {
+	if r.pos >= len(r.buf) {
+		return 0, 0, false
+	}
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, false
+	}
+	return int(tag >> 3), wireType(tag & 0x7), true
+}
+
+// varint reads a base-128 varint.
+func (r *pbReader) varint() (uint64, error) {
+	var result uint64
+	var shift uint
+	for {
+		if r.pos >= len(r.buf) {
+			return 0, errors.New("osmgraph: truncated varint")
+		}
+		b := r.buf[r.pos]
+		r.pos++
+		result |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return result, nil
+		}
+		shift += 7
+		if shift >= 64 {
+			return 0, errors.New("osmgraph: varint too long")
+		}
+	}
+}
+
+// skipVarint discards a varint-encoded value.
+func (r *pbReader) skipVarint() error {
+	_, err := r.varint()
+	return err
+}
+
+// bytesField reads a length-delimited field's raw bytes.
+func (r *pbReader) bytesField() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	end := r.pos + int(n)
+	if end > len(r.buf) {
+		return nil, errors.New("osmgraph: truncated length-delimited field")
+	}
+	b := r.buf[r.pos:end]
+	r.pos = end
+	return b, nil
+}
+
+// skipField discards a field's value given its wire type.
+func (r *pbReader) skipField(wt wireType) error {
+	switch wt {
+	case wireVarint:
+		return r.skipVarint()
+	case wireBytes:
+		_, err := r.bytesField()
+		return err
+	case wireFixed64:
+		if r.pos+8 > len(r.buf) {
+			return errors.New("osmgraph: truncated fixed64 field")
+		}
+		r.pos += 8
+		return nil
+	case wireFixed32:
+		if r.pos+4 > len(r.buf) {
+			return errors.New("osmgraph: truncated fixed32 field")
+		}
+		r.pos += 4
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("osmgraph: unsupported wire type %d", wt))
+	}
+}
+
+// packedVarints decodes a length-delimited field as a sequence of
+// varints (used for protobuf "packed=true" repeated fields).
+func packedVarints(b []byte) ([]int64, error) {
+	r := &pbReader{buf: b}
+	var out []int64
+	for r.pos < len(r.buf) {
+		v, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, zigzagOrRaw(v))
+	}
+	return out, nil
+}
+
+// packedUint32s decodes a length-delimited field as a sequence of
+// unsigned varints.
+func packedUint32s(b []byte) ([]uint32, error) {
+	r := &pbReader{buf: b}
+	var out []uint32
+	for r.pos < len(r.buf) {
+		v, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, uint32(v))
+	}
+	return out, nil
+}
+
+// zigzagOrRaw returns v as-is; callers that need zigzag (sint64)
+// decoding call zigzag explicitly. This indirection exists so plain
+// int64 varints and sint64 varints can share packedVarints.
+func zigzagOrRaw(v uint64) int64 {
+	return int64(v)
+}
+
+// zigzag decodes a zigzag-encoded (sint64) varint.
+func zigzag(v int64) int64 {
+	u := uint64(v)
+	return int64(u>>1) ^ -int64(u&1)
+}
@@ -0,0 +1,211 @@
+// Package utm is a bidirectional Universal Transverse Mercator converter
+// for go
+//
+// Reference for UTM can be found here: https://en.wikipedia.org/wiki/Universal_Transverse_Mercator_coordinate_system
+package utm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"latlong"
+	"math"
+)
+
+// Convert angle in radians to angle in degrees
+func deg(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Convert angle in degrees to angle in radians
+func rad(deg float64) float64 { return deg * math.Pi / 180 }
+
+const (
+	// WGS84 ellipsoid parameters.
+	semiMajorAxis = 6378137.0
+	flattening    = 1 / 298.257223563
+
+	// k0 is the scale factor along the central meridian.
+	k0 = 0.9996
+
+	falseEasting       = 500000.0
+	falseNorthingSouth = 10000000.0
+
+	// bandLetters are the UTM latitude band letters, south to north,
+	// covering 80S-84N in 8 degree bands ('I' and 'O' are skipped).
+	bandLetters = "CDEFGHJKLMNPQRSTUVWXX"
+)
+
+// Coordinate represents a position on earth in the Universal Transverse
+// Mercator horizontal position representation.
+type Coordinate struct {
+	Zone     int
+	Band     byte
+	Easting  float64
+	Northing float64
+}
+
+// zoneBand returns the UTM zone number and latitude band letter for a
+// given latitude/longitude, in degrees.
+func zoneBand(lat, lon float64) (int, byte) {
+	zone := int((lon+180)/6) + 1
+
+	idx := int((lat + 80) / 8)
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(bandLetters) {
+		idx = len(bandLetters) - 1
+	}
+
+	return zone, bandLetters[idx]
+}
+
+// ToCoordinate converts a latlong.LatLonger to its corresponding UTM
+// Coordinate.
+func ToCoordinate(l latlong.LatLonger) Coordinate {
+	lat, lon := l.Lat(), l.Lon()
+	zone, band := zoneBand(lat, lon)
+
+	centralMeridian := float64(zone*6 - 183)
+	phi := rad(lat)
+	lambda := rad(lon - centralMeridian)
+
+	e2 := flattening * (2 - flattening)
+	ep2 := e2 / (1 - e2)
+
+	n := semiMajorAxis / math.Sqrt(1-e2*math.Sin(phi)*math.Sin(phi))
+	t := math.Tan(phi) * math.Tan(phi)
+	c := ep2 * math.Cos(phi) * math.Cos(phi)
+	a := math.Cos(phi) * lambda
+
+	m := semiMajorAxis * ((1-e2/4-3*e2*e2/64-5*e2*e2*e2/256)*phi -
+		(3*e2/8+3*e2*e2/32+45*e2*e2*e2/1024)*math.Sin(2*phi) +
+		(15*e2*e2/256+45*e2*e2*e2/1024)*math.Sin(4*phi) -
+		(35*e2*e2*e2/3072)*math.Sin(6*phi))
+
+	easting := falseEasting + k0*n*(a+(1-t+c)*a*a*a/6+
+		(5-18*t+t*t+72*c-58*ep2)*a*a*a*a*a/120)
+
+	northing := k0 * (m + n*math.Tan(phi)*(a*a/2+
+		(5-t+9*c+4*c*c)*a*a*a*a/24+
+		(61-58*t+t*t+600*c-330*ep2)*a*a*a*a*a*a/720))
+
+	if lat < 0 {
+		northing += falseNorthingSouth
+	}
+
+	return Coordinate{Zone: zone, Band: band, Easting: easting, Northing: northing}
+}
+
+// Lat returns the latitude, in degrees, of the centroid of this UTM
+// Coordinate.
+func (c Coordinate) Lat() float64 {
+	lat, _ := c.toLatLon()
+	return lat
+}
+
+// Lon returns the longitude, in degrees, of the centroid of this UTM
+// Coordinate.
+func (c Coordinate) Lon() float64 {
+	_, lon := c.toLatLon()
+	return lon
+}
+
+// northernHemisphere reports whether Band places this Coordinate north
+// of the equator.
+func (c Coordinate) northernHemisphere() bool {
+	idx := indexByte(bandLetters, c.Band)
+	return idx >= indexByte(bandLetters, 'N')
+}
+
+func indexByte(s string, b byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// toLatLon converts this Coordinate back to latitude/longitude, in
+// degrees.
+func (c Coordinate) toLatLon() (lat, lon float64) {
+	northing := c.Northing
+	if !c.northernHemisphere() {
+		northing -= falseNorthingSouth
+	}
+
+	e2 := flattening * (2 - flattening)
+	ep2 := e2 / (1 - e2)
+	e1 := (1 - math.Sqrt(1-e2)) / (1 + math.Sqrt(1-e2))
+
+	m := northing / k0
+	mu := m / (semiMajorAxis * (1 - e2/4 - 3*e2*e2/64 - 5*e2*e2*e2/256))
+
+	phi1 := mu + (3*e1/2-27*e1*e1*e1/32)*math.Sin(2*mu) +
+		(21*e1*e1/16-55*e1*e1*e1*e1/32)*math.Sin(4*mu) +
+		(151*e1*e1*e1/96)*math.Sin(6*mu)
+
+	n1 := semiMajorAxis / math.Sqrt(1-e2*math.Sin(phi1)*math.Sin(phi1))
+	t1 := math.Tan(phi1) * math.Tan(phi1)
+	c1 := ep2 * math.Cos(phi1) * math.Cos(phi1)
+	r1 := semiMajorAxis * (1 - e2) / math.Pow(1-e2*math.Sin(phi1)*math.Sin(phi1), 1.5)
+	d := (c.Easting - falseEasting) / (n1 * k0)
+
+	phi := phi1 - (n1*math.Tan(phi1)/r1)*(d*d/2-
+		(5+3*t1+10*c1-4*c1*c1-9*ep2)*d*d*d*d/24+
+		(61+90*t1+298*c1+45*t1*t1-252*ep2-3*c1*c1)*d*d*d*d*d*d/720)
+
+	lambda := (d - (1+2*t1+c1)*d*d*d/6 +
+		(5-2*c1+28*t1-3*c1*c1+8*ep2+24*t1*t1)*d*d*d*d*d/120) / math.Cos(phi1)
+
+	centralMeridian := float64(c.Zone*6 - 183)
+
+	return deg(phi), centralMeridian + deg(lambda)
+}
+
+// UnmarshalJSON unmarshals a Coordinate from JSON.
+func (c *Coordinate) UnmarshalJSON(b []byte) error {
+	// Try to unmarshal the JSON object
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+
+	// Check the number of fields
+	if len(obj) > 4 {
+		return errors.New(fmt.Sprintf("Too many fields for: utm.Coordinate"))
+	}
+	if len(obj) < 4 {
+		return errors.New(fmt.Sprintf("Not enough fields for: utm.Coordinate"))
+	}
+
+	for _, field := range []string{"Zone", "Band", "Easting", "Northing"} {
+		if _, ok := obj[field]; !ok {
+			return errors.New("Missing field: \"" + field + "\"")
+		}
+	}
+
+	zone, ok := obj["Zone"].(float64)
+	if !ok {
+		return errors.New("Wrong type for field: \"Zone\"")
+	}
+	band, ok := obj["Band"].(string)
+	if !ok || len(band) != 1 {
+		return errors.New("Wrong type for field: \"Band\"")
+	}
+	easting, ok := obj["Easting"].(float64)
+	if !ok {
+		return errors.New("Wrong type for field: \"Easting\"")
+	}
+	northing, ok := obj["Northing"].(float64)
+	if !ok {
+		return errors.New("Wrong type for field: \"Northing\"")
+	}
+
+	c.Zone = int(zone)
+	c.Band = band[0]
+	c.Easting = easting
+	c.Northing = northing
+
+	return nil
+}